@@ -0,0 +1,34 @@
+package syncengine
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryBackoff 依重試次數決定下一次可重試的等待時間。
+type RetryBackoff func(attempts int) time.Duration
+
+// defaultRetryBackoff 實作 min(base * 2^attempts, max) * (1 ± jitter)，
+// 在 RetryAfter 的基礎上做指數退避並加上抖動，避免 retry 集中在同一時間點打過去。
+func defaultRetryBackoff(base, max time.Duration, jitter float64) RetryBackoff {
+	if base <= 0 {
+		base = time.Second
+	}
+	if max <= 0 {
+		max = base * 32
+	}
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 0; i < attempts && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		if jitter > 0 {
+			delta := float64(d) * jitter
+			d = d - time.Duration(delta) + time.Duration(rand.Float64()*2*delta)
+		}
+		return d
+	}
+}
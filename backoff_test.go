@@ -0,0 +1,51 @@
+package syncengine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultRetryBackoffGrowsExponentiallyAndCaps(t *testing.T) {
+	backoff := defaultRetryBackoff(time.Second, 16*time.Second, 0)
+
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{4, 16 * time.Second},
+		{10, 16 * time.Second}, // 超過 max 後應該被夾住
+	}
+	for _, c := range cases {
+		got := backoff(c.attempts)
+		if got != c.want {
+			t.Errorf("backoff(%d) = %v, want %v", c.attempts, got, c.want)
+		}
+	}
+}
+
+func TestDefaultRetryBackoffJitterStaysWithinBounds(t *testing.T) {
+	const base = time.Second
+	backoff := defaultRetryBackoff(base, 16*time.Second, 0.2)
+
+	for i := 0; i < 50; i++ {
+		d := backoff(0)
+		lo := time.Duration(float64(base) * 0.8)
+		hi := time.Duration(float64(base) * 1.2)
+		if d < lo || d > hi {
+			t.Fatalf("backoff(0) = %v, want within [%v, %v]", d, lo, hi)
+		}
+	}
+}
+
+func TestDefaultRetryBackoffDefaultsWhenUnset(t *testing.T) {
+	backoff := defaultRetryBackoff(0, 0, 0)
+	if got, want := backoff(0), time.Second; got != want {
+		t.Errorf("backoff(0) with base<=0 = %v, want default %v", got, want)
+	}
+	if got, want := backoff(100), 32*time.Second; got != want {
+		t.Errorf("backoff(100) with max<=0 = %v, want default cap %v", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package syncengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type dlItem struct {
+	key   string
+	group string
+	ts    int64
+}
+
+func (i *dlItem) Key() string      { return i.key }
+func (i *dlItem) Group() string    { return i.group }
+func (i *dlItem) Timestamp() int64 { return i.ts }
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("condition not met within %v", timeout)
+}
+
+// TestDeadLetterAfterMaxRetry 確認一個永遠不被 ack 的項目，在耗盡 MaxRetry
+// 之後會被移出 items、進 DeadLetters，並觸發一次 OnDeadLetter。
+func TestDeadLetterAfterMaxRetry(t *testing.T) {
+	var mu sync.Mutex
+	var deadLettered []string
+
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   2,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: 5 * time.Millisecond,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			// 故意不 ack，逼項目一直重試到耗盡為止。
+		},
+		OnDeadLetter: func(group string, item SyncItem, attempts int) {
+			mu.Lock()
+			deadLettered = append(deadLettered, item.Key())
+			mu.Unlock()
+		},
+		Shards: 1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(deadLettered) == 1 && deadLettered[0] == "a"
+	})
+
+	dead := engine.DeadLetters("g1")
+	if len(dead) != 1 || dead[0].Key() != "a" {
+		t.Fatalf("expected DeadLetters to contain %q, got %v", "a", dead)
+	}
+}
+
+// TestRequeueBringsItemBackToActiveRetry 確認 Requeue 之後，項目會離開
+// DeadLetters、重試次數歸零，並重新參與 dispatch。
+func TestRequeueBringsItemBackToActiveRetry(t *testing.T) {
+	var mu sync.Mutex
+	dispatchCount := map[string]int{}
+
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   1,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: 5 * time.Millisecond,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			mu.Lock()
+			for _, it := range batch {
+				dispatchCount[it.Key()]++
+			}
+			mu.Unlock()
+		},
+		Shards: 1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	waitFor(t, 2*time.Second, func() bool {
+		return len(engine.DeadLetters("g1")) == 1
+	})
+
+	engine.Requeue("g1", "a")
+
+	if len(engine.DeadLetters("g1")) != 0 {
+		t.Fatalf("expected DeadLetters to be empty right after Requeue")
+	}
+
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return dispatchCount["a"] >= 2
+	})
+}
+
+// TestOnDeadLetterCallbackCanReenter 確認 OnDeadLetter 不是在 ig.mu 持有的
+// 情況下被呼叫：callback 裡呼叫 Requeue（需要重新拿同一個 ig.mu）不會死鎖。
+func TestOnDeadLetterCallbackCanReenter(t *testing.T) {
+	done := make(chan struct{})
+
+	var engine *SyncEngine
+	engine = NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   1,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: 5 * time.Millisecond,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {},
+		OnDeadLetter: func(group string, item SyncItem, attempts int) {
+			engine.Requeue(group, item.Key())
+			close(done)
+		},
+		Shards: 1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDeadLetter calling back into Requeue deadlocked")
+	}
+}
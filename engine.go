@@ -1,186 +1,686 @@
 package syncengine
 
 import (
+	"container/heap"
+	"context"
+	"errors"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrEngineStopped 在 Stop 呼叫之後，再呼叫 Add 會回傳這個錯誤。
+var ErrEngineStopped = errors.New("syncengine: engine stopped")
+
 type SyncEngine struct {
-	cache      sync.Map // map[group]string]*itemGroup
+	shards     []*shard
 	cfg        Config
+	backoff    RetryBackoff
+	metrics    Metrics
 	dispatchCh chan []SyncItem
 	stop       chan struct{}
+	stopOnce   sync.Once
+	stopped    int32          // atomic：1 代表已經 Stop，Add 會開始回傳 ErrEngineStopped
+	inflight   sync.WaitGroup // 涵蓋每一次 executor.Submit 提交的 dispatch，讓 Stop 可以等到它們都跑完
+	loops      sync.WaitGroup // 涵蓋 Start 啟動的 dispatchLoop/retryLoop，Stop 必須先等它們真的退出，才能對 inflight 做 flushAll+Wait
 }
 
 type itemGroup struct {
-	mu       sync.Mutex
-	items    map[string]SyncItem // key -> item
-	attempts map[string]int      // key -> retry count
-	lastSent int64               // UnixNano
+	mu          sync.Mutex
+	heap        groupHeap            // 依 priority desc, Timestamp asc 排序的待處理項目
+	unsentHeap  unsentHeap           // 只裝尚未送出的節點，讓 popUnsentBatch/hasUrgent 不必掃過整個 heap
+	index       map[string]*heapNode // key -> heap 節點，O(1) 查找、O(log n) 增刪
+	attempts    map[string]int       // key -> retry count
+	nextRetryAt map[string]int64     // key -> 下次可重試時間，UnixNano
+	deadLetters map[string]SyncItem  // key -> 已耗盡重試次數、移出 items 的項目
+	lastSent    int64                // UnixNano
+	bucket      *tokenBucket         // nil 代表這個 group 不限速
+}
+
+// earliestRetryAt 回傳這個 group 裡最早可重試的時間，供 shard 的 retryHeap
+// 排序使用；呼叫端須持有 ig.mu。沒有等待中的重試時回傳 noPendingRetry。
+func (ig *itemGroup) earliestRetryAt() int64 {
+	earliest := noPendingRetry
+	for key, at := range ig.nextRetryAt {
+		if ig.attempts[key] == 0 {
+			continue
+		}
+		if at < earliest {
+			earliest = at
+		}
+	}
+	return earliest
 }
 
 type LoggerFunc func(format string, args ...any)
 
 type Config struct {
-	BatchSize  int                                  // 單次觸發發送的最小項目數，例如 5：超過就立刻送出
-	MaxRetry   int                                  // 單一資料最大重試次數，超過後就不再派發
-	FlushAfter time.Duration                        // 每筆超過這個等待時間，即使未滿也會 flush
-	RetryAfter time.Duration                        // 上次發送超過多久後才允許 retry
-	Tick       time.Duration                        // 引擎內部輪詢週期，影響 dispatch/retry 頻率
-	OnDispatch func(group string, batch []SyncItem) // 外部注入的發送函式：當資料可送時會呼叫此函式
+	BatchSize  int                                                       // 單次觸發發送的最小項目數，例如 5：超過就立刻送出
+	MaxRetry   int                                                       // 單一資料最大重試次數，超過後就不再派發
+	FlushAfter time.Duration                                             // 每筆超過這個等待時間，即使未滿也會 flush
+	RetryAfter time.Duration                                             // 重試等待的基準：預設 backoff 下第 n 次發送後等 RetryAfter*2^n（最多 32 倍，±20% 抖動）
+	Tick       time.Duration                                             // 引擎內部輪詢週期，影響 dispatch/retry 頻率
+	OnDispatch func(ctx context.Context, group string, batch []SyncItem) // 外部注入的發送函式：當資料可送時會呼叫此函式，ctx 帶有這次 dispatch 的 span
 
 	Executor AsyncExecutor // Optional: 預設為 DefaultExecutor，可傳入自定義 goroutine pool
 	Logger   LoggerFunc    // Optional
+
+	Storage Storage // Optional: 設定後 Add/Ack 會 write-through，NewEngine 啟動時回放未 ack 的項目
+
+	PerGroupRateLimit RateLimit    // Optional: 每個 group 各自的 token bucket，Rate <= 0 代表不限速
+	RetryBackoff      RetryBackoff // Optional: 預設為以 RetryAfter 為底的指數退避加抖動
+
+	UrgentPriority int // Optional: > 0 時，有尚未送出的項目 priority 達到這個門檻就無視 FlushAfter 立刻 flush；<= 0 代表不啟用
+
+	Shards int // Optional: group 要切成幾個 shard，各自獨立跑 dispatch/retry goroutine；預設 runtime.GOMAXPROCS(0)
+
+	OnDeadLetter func(group string, item SyncItem, attempts int) // Optional: 項目耗盡重試次數時呼叫一次
+
+	Metrics Metrics // Optional: 預設為 nopMetrics，可用 prom 子套件接 Prometheus
 }
 
 func NewEngine(cfg Config) *SyncEngine {
-	return &SyncEngine{
+	numShards := cfg.Shards
+	if numShards <= 0 {
+		numShards = runtime.GOMAXPROCS(0)
+	}
+	shards := make([]*shard, numShards)
+	for i := range shards {
+		shards[i] = newShard()
+	}
+
+	e := &SyncEngine{
+		shards:     shards,
 		cfg:        cfg,
 		dispatchCh: make(chan []SyncItem),
 		stop:       make(chan struct{}),
 	}
+	e.backoff = cfg.RetryBackoff
+	if e.backoff == nil {
+		e.backoff = defaultRetryBackoff(cfg.RetryAfter, 0, 0.2)
+	}
+	e.metrics = cfg.Metrics
+	if e.metrics == nil {
+		e.metrics = nopMetrics{}
+	}
+	if cfg.Storage != nil {
+		e.replay()
+	}
+	return e
 }
 
-func (e *SyncEngine) Start() {
-	go e.dispatchLoop()
-	go e.retryLoop()
+// replay 從 Storage 讀回尚未 ack 的項目，讓引擎在崩潰重啟後可以繼續送。
+// 直接灌進 shard，不再透過 Add 寫回 Storage，避免重複寫入同一筆記錄。
+func (e *SyncEngine) replay() {
+	items, err := e.cfg.Storage.LoadPending()
+	if err != nil {
+		if e.cfg.Logger != nil {
+			e.cfg.Logger("[WARN] replay pending items failed: %v", err)
+		}
+		return
+	}
+	for _, item := range items {
+		sh, ig := e.groupFor(item.Group())
+		ig.mu.Lock()
+		ig.upsert(item)
+		ig.mu.Unlock()
+
+		sh.mu.Lock()
+		sh.markDirty(item.Group())
+		sh.mu.Unlock()
+	}
+}
+
+// shardFor 回傳 group 所屬的 shard，同一個 group 一律落在同一個 shard。
+func (e *SyncEngine) shardFor(group string) *shard {
+	return e.shards[shardIndex(group, len(e.shards))]
+}
+
+// groupFor 回傳 group 所屬的 shard 跟它的 itemGroup，不存在時會建立一個新的。
+func (e *SyncEngine) groupFor(group string) (*shard, *itemGroup) {
+	sh := e.shardFor(group)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	ig, ok := sh.groups[group]
+	if !ok {
+		ig = e.newItemGroup()
+		sh.groups[group] = ig
+	}
+	return sh, ig
+}
+
+// lookupGroup 只在 group 已存在時回傳它，不會建立新的。
+func (e *SyncEngine) lookupGroup(group string) (*shard, *itemGroup, bool) {
+	sh := e.shardFor(group)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	ig, ok := sh.groups[group]
+	return sh, ig, ok
 }
 
-func (e *SyncEngine) Stop() {
-	close(e.stop)
+func (e *SyncEngine) newItemGroup() *itemGroup {
+	ig := &itemGroup{
+		index:       make(map[string]*heapNode),
+		attempts:    make(map[string]int),
+		nextRetryAt: make(map[string]int64),
+		deadLetters: make(map[string]SyncItem),
+	}
+	if e.cfg.PerGroupRateLimit.Rate > 0 {
+		ig.bucket = newTokenBucket(e.cfg.PerGroupRateLimit)
+	}
+	return ig
+}
+
+func (e *SyncEngine) Start() {
+	for _, sh := range e.shards {
+		e.loops.Add(2)
+		go e.dispatchLoop(sh)
+		go e.retryLoop(sh)
+	}
 }
 
-func (e *SyncEngine) Add(item SyncItem) {
-	raw, _ := e.cache.LoadOrStore(item.Group(), &itemGroup{
-		items:    make(map[string]SyncItem),
-		attempts: make(map[string]int),
+// Stop 讓引擎停止接受新的 Add（之後 Add 一律回傳 ErrEngineStopped），等
+// dispatchLoop/retryLoop 真的都退出（這樣才不會有新的一輪 dispatchGroup/
+// retryGroup 在 flushAll 之後才跑 e.inflight.Add，跟下面的 inflight.Wait
+// 競爭），再強制把每個 group 目前尚未送出的項目都 flush 一次（無視
+// BatchSize/FlushAfter 門檻），然後等所有已經提交給 executor 的 dispatch
+// 跑完再返回；ctx 到期時就算還沒完成也會直接返回，並回傳 ctx.Err()。可以
+// 安全地呼叫多次。
+func (e *SyncEngine) Stop(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		atomic.StoreInt32(&e.stopped, 1)
+		close(e.stop)
 	})
-	ig := raw.(*itemGroup)
+
+	done := make(chan struct{})
+	go func() {
+		e.loops.Wait()
+		e.flushAll()
+		e.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain 強制 flush 所有 group，然後等到每個 group 都清空（len(ig.index)==0）
+// 或逾時為止，回傳是否真的全部清空。不會停止引擎接受新的 Add，適合在測試
+// 或滾動部署時確保目前已知的資料都已經送出。
+func (e *SyncEngine) Drain(timeout time.Duration) bool {
+	e.flushAll()
+
+	tick := e.cfg.Tick
+	if tick <= 0 {
+		tick = 10 * time.Millisecond
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		if e.allEmpty() {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return e.allEmpty()
+		}
+		time.Sleep(tick)
+	}
+}
+
+// flushAll 強制把每個 shard 裡所有 group 尚未送出的項目全部送出，無視
+// BatchSize/FlushAfter 門檻跟 rate limit，用於 Stop/Drain 的最後一次 flush。
+func (e *SyncEngine) flushAll() {
+	for _, sh := range e.shards {
+		sh.mu.Lock()
+		groups := make([]string, 0, len(sh.groups))
+		for group := range sh.groups {
+			groups = append(groups, group)
+		}
+		sh.mu.Unlock()
+
+		for _, group := range groups {
+			sh.mu.Lock()
+			ig, ok := sh.groups[group]
+			sh.mu.Unlock()
+			if ok {
+				e.forceFlushGroup(group, ig)
+			}
+		}
+	}
+}
+
+// forceFlushGroup 依 BatchSize 切批，把 group 裡所有尚未送出的項目送完為止。
+func (e *SyncEngine) forceFlushGroup(group string, ig *itemGroup) {
+	for {
+		ig.mu.Lock()
+		if len(ig.unsentHeap) == 0 {
+			ig.mu.Unlock()
+			return
+		}
+
+		batch := ig.popUnsentBatch(e.cfg.BatchSize)
+		if len(batch) == 0 {
+			ig.mu.Unlock()
+			return
+		}
+		sentAt := time.Now().UnixNano()
+		attempts := make([]int, len(batch))
+		for i, b := range batch {
+			ig.attempts[b.Key()]++
+			ig.nextRetryAt[b.Key()] = sentAt + e.backoff(ig.attempts[b.Key()]).Nanoseconds()
+			attempts[i] = ig.attempts[b.Key()]
+		}
+		ig.lastSent = sentAt
+		ig.mu.Unlock()
+
+		e.submitDispatch(group, batch, attempts, "start dispatch (flush)...")
+	}
+}
+
+// allEmpty 回傳是否每個 group 的 items 都已經清空。
+func (e *SyncEngine) allEmpty() bool {
+	for _, sh := range e.shards {
+		sh.mu.Lock()
+		groups := make([]*itemGroup, 0, len(sh.groups))
+		for _, ig := range sh.groups {
+			groups = append(groups, ig)
+		}
+		sh.mu.Unlock()
+
+		for _, ig := range groups {
+			ig.mu.Lock()
+			n := len(ig.index)
+			ig.mu.Unlock()
+			if n > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (e *SyncEngine) Add(item SyncItem) error {
+	if atomic.LoadInt32(&e.stopped) != 0 {
+		return ErrEngineStopped
+	}
+
+	if e.cfg.Storage != nil {
+		if err := e.cfg.Storage.Append(item); err != nil && e.cfg.Logger != nil {
+			e.cfg.Logger("[WARN] storage append failed: %v", err)
+		}
+	}
+
+	sh, ig := e.groupFor(item.Group())
 
 	ig.mu.Lock()
-	defer ig.mu.Unlock()
-	ig.items[item.Key()] = item
+	ig.upsert(item)
+	pending := len(ig.index)
+	ig.mu.Unlock()
+
+	sh.mu.Lock()
+	sh.markDirty(item.Group())
+	sh.mu.Unlock()
+
+	e.metrics.IncItemsAdded(item.Group())
+	e.metrics.SetPendingItems(item.Group(), pending)
+	return nil
 }
 
 func (e *SyncEngine) Ack(group string, keys []string) {
-	val, ok := e.cache.Load(group)
+	sh, ig, ok := e.lookupGroup(group)
 	if !ok {
 		return
 	}
-	ig := val.(*itemGroup)
 
 	ig.mu.Lock()
-	defer ig.mu.Unlock()
 	for _, k := range keys {
-		delete(ig.items, k)
+		ig.remove(k)
 		delete(ig.attempts, k)
+		delete(ig.nextRetryAt, k)
 	}
+	pending := len(ig.index)
+
+	// touchRetry 讀 ig.nextRetryAt/ig.attempts，必須在放開 ig.mu 之前呼叫，
+	// 否則跟其他同時在改這兩個 map 的 goroutine（例如另一個 tick 的
+	// dispatchGroup/retryGroup）之間會是未加鎖的 concurrent map read/write。
+	sh.mu.Lock()
+	sh.touchRetry(group, ig)
+	sh.mu.Unlock()
+	ig.mu.Unlock()
+
+	e.metrics.IncItemsAcked(group, len(keys))
+	e.metrics.SetPendingItems(group, pending)
+
+	if e.cfg.Storage != nil {
+		if err := e.cfg.Storage.MarkAcked(group, keys); err != nil && e.cfg.Logger != nil {
+			e.cfg.Logger("[WARN] storage mark acked failed: %v", err)
+		}
+	}
+}
+
+// DeadLetters 回傳指定 group 目前已耗盡重試次數的項目，供檢查或轉存之用。
+func (e *SyncEngine) DeadLetters(group string) []SyncItem {
+	_, ig, ok := e.lookupGroup(group)
+	if !ok {
+		return nil
+	}
+
+	ig.mu.Lock()
+	defer ig.mu.Unlock()
+	out := make([]SyncItem, 0, len(ig.deadLetters))
+	for _, it := range ig.deadLetters {
+		out = append(out, it)
+	}
+	return out
+}
+
+// Requeue 把一筆 dead-letter 項目放回 items、重試次數歸零，讓它重新參與 dispatch。
+func (e *SyncEngine) Requeue(group, key string) {
+	sh, ig, ok := e.lookupGroup(group)
+	if !ok {
+		return
+	}
+
+	ig.mu.Lock()
+	it, ok := ig.deadLetters[key]
+	if !ok {
+		ig.mu.Unlock()
+		return
+	}
+	delete(ig.deadLetters, key)
+	ig.upsert(it)
+	ig.attempts[key] = 0
+	ig.mu.Unlock()
+
+	sh.mu.Lock()
+	sh.markDirty(group)
+	sh.mu.Unlock()
+}
+
+// submitDispatch 把一個 batch 送進 executor 執行 OnDispatch，順便記錄 dispatch
+// latency、panic 計數，並開一個涵蓋這次呼叫的 span 讓 ctx 往下傳遞。
+func (e *SyncEngine) submitDispatch(group string, batch []SyncItem, attempts []int, startMsg string) {
+	executor := e.cfg.Executor
+	if executor == nil {
+		executor = &DefaultExecutor{}
+	}
+
+	now := time.Now()
+	for _, it := range batch {
+		e.metrics.ObserveItemAgeAtDispatch(group, now.Sub(time.Unix(0, it.Timestamp())))
+	}
+
+	e.inflight.Add(1)
+	executor.Submit(func() {
+		defer e.inflight.Done()
+
+		ctx, span := startDispatchSpan(group, batch, attempts)
+		defer span.End()
+
+		start := time.Now()
+		defer func() {
+			e.metrics.ObserveDispatchLatency(group, time.Since(start))
+			if r := recover(); r != nil {
+				e.metrics.IncDispatchPanics(group)
+				if e.cfg.Logger != nil {
+					e.cfg.Logger("[WARN] dispatch panic: %v", r)
+				}
+			}
+		}()
+		if e.cfg.Logger != nil {
+			e.cfg.Logger(startMsg)
+		}
+		e.metrics.IncBatchesDispatched(group)
+		e.cfg.OnDispatch(ctx, group, batch)
+	})
 }
 
-func (e *SyncEngine) dispatchLoop() {
+// dispatchLoop 只掃描這個 shard 自己的 dirty group，數量跟著活躍流量走，
+// 不受其他 shard 或整體 group 總數影響。
+func (e *SyncEngine) dispatchLoop(sh *shard) {
+	defer e.loops.Done()
 	ticker := time.NewTicker(e.cfg.Tick)
 	for {
 		select {
 		case <-ticker.C:
 			now := time.Now().UnixNano()
-			e.cache.Range(func(k, v any) bool {
-				ig := v.(*itemGroup)
-
-				ig.mu.Lock()
-				unsent := make([]SyncItem, 0)
-				for key, it := range ig.items {
-					if ig.attempts[key] == 0 {
-						unsent = append(unsent, it)
-					}
-				}
-				shouldFlush := len(unsent) >= e.cfg.BatchSize || now-ig.lastSent > e.cfg.FlushAfter.Nanoseconds()
-				if len(unsent) > 0 && shouldFlush {
-					// 只要有資料，且超過間隔或數量，皆可送
-					batch := unsent[:min(e.cfg.BatchSize, len(unsent))]
-
-					for _, b := range batch {
-						ig.attempts[b.Key()]++
-					}
-					ig.lastSent = time.Now().UnixNano()
-
-					executor := e.cfg.Executor
-					if executor == nil {
-						executor = &DefaultExecutor{}
-					}
-
-					executor.Submit(func() {
-						defer func() {
-							if r := recover(); r != nil {
-								e.cfg.Logger("[WARN] dispatch panic: %v", r)
-							}
-						}()
-						e.cfg.Logger("start dispatch...")
-						e.cfg.OnDispatch(k.(string), batch)
-					})
+
+			sh.mu.Lock()
+			dirty := make([]string, 0, len(sh.dirty))
+			for group := range sh.dirty {
+				dirty = append(dirty, group)
+			}
+			sh.mu.Unlock()
+
+			totalGroups := 0
+			for _, other := range e.shards {
+				other.mu.Lock()
+				totalGroups += len(other.groups)
+				other.mu.Unlock()
+			}
+
+			for _, group := range dirty {
+				sh.mu.Lock()
+				ig, ok := sh.groups[group]
+				sh.mu.Unlock()
+				if !ok {
+					continue
 				}
-				ig.mu.Unlock()
-				return true
-			})
+				e.dispatchGroup(sh, group, ig, now)
+			}
+
+			e.metrics.SetGroups(totalGroups)
 		case <-e.stop:
 			return
 		}
 	}
 }
 
-func (e *SyncEngine) retryLoop() {
+// dispatchGroup 評估單一 group 是否該 flush，需要的話送出一批並更新 dirty/
+// retryHeap 狀態。
+func (e *SyncEngine) dispatchGroup(sh *shard, group string, ig *itemGroup, now int64) {
+	ig.mu.Lock()
+	pendingUnsent := len(ig.unsentHeap)
+	shouldFlush := pendingUnsent >= e.cfg.BatchSize ||
+		now-ig.lastSent > e.cfg.FlushAfter.Nanoseconds() ||
+		(e.cfg.UrgentPriority > 0 && ig.hasUrgent(e.cfg.UrgentPriority))
+	if pendingUnsent == 0 {
+		ig.mu.Unlock()
+		sh.mu.Lock()
+		sh.clearDirty(group)
+		sh.mu.Unlock()
+		return
+	}
+	if !shouldFlush {
+		ig.mu.Unlock()
+		return
+	}
+	if ig.bucket != nil && !ig.bucket.Allow() {
+		if e.cfg.Logger != nil {
+			e.cfg.Logger("[DEBUG] group %s out of rate-limit tokens, skip this tick", group)
+		}
+		ig.mu.Unlock()
+		return
+	}
+
+	// 依 priority desc、Timestamp asc 從 heap 取出最該送出的一批
+	batch := ig.popUnsentBatch(e.cfg.BatchSize)
+
+	sentAt := time.Now().UnixNano()
+	attempts := make([]int, len(batch))
+	for i, b := range batch {
+		ig.attempts[b.Key()]++
+		ig.nextRetryAt[b.Key()] = sentAt + e.backoff(ig.attempts[b.Key()]).Nanoseconds()
+		attempts[i] = ig.attempts[b.Key()]
+	}
+	ig.lastSent = sentAt
+	remaining := len(ig.unsentHeap)
+
+	// touchRetry 必須在 ig.mu 還鎖著的時候呼叫，理由同 Ack。
+	sh.mu.Lock()
+	if remaining == 0 {
+		sh.clearDirty(group)
+	}
+	sh.touchRetry(group, ig)
+	sh.mu.Unlock()
+	ig.mu.Unlock()
+
+	e.submitDispatch(group, batch, attempts, "start dispatch...")
+}
+
+// retryLoop 只檢查 retryHeap 堆頂，堆頂時間還沒到就整個 shard 都不用看，
+// 讓 retry 掃描成本跟著「有多少 group 真的在等重試」走，而不是 group 總數。
+func (e *SyncEngine) retryLoop(sh *shard) {
+	defer e.loops.Done()
 	ticker := time.NewTicker(e.cfg.Tick)
 	for {
 		select {
 		case <-ticker.C:
 			now := time.Now().UnixNano()
-			e.cache.Range(func(k, v any) bool {
-				group := k.(string)
-				ig := v.(*itemGroup)
-
-				ig.mu.Lock()
-				if len(ig.items) == 0 {
-					ig.mu.Unlock()
-					return true
-				}
-				if ig.lastSent == 0 {
-					ig.mu.Unlock()
-					return true
-				}
-				if now-ig.lastSent < e.cfg.RetryAfter.Nanoseconds() {
-					ig.mu.Unlock()
-					return true
-				}
-
-				retryable := make([]SyncItem, 0)
-				for key, it := range ig.items {
-					if ig.attempts[key] < e.cfg.MaxRetry {
-						ig.attempts[key]++
-						retryable = append(retryable, it)
-					}
+			for {
+				sh.mu.Lock()
+				if len(sh.retryHeap) == 0 || sh.retryHeap[0].at > now {
+					sh.mu.Unlock()
+					break
 				}
-				if len(retryable) > 0 {
-					ig.lastSent = now
-
-					executor := e.cfg.Executor
-					if executor == nil {
-						executor = &DefaultExecutor{}
-					}
-
-					executor.Submit(func() {
-						defer func() {
-							if r := recover(); r != nil {
-								e.cfg.Logger("[WARN] dispatch panic: %v", r)
-							}
-						}()
-						e.cfg.Logger("start retrying...")
-						e.cfg.OnDispatch(group, retryable)
-					})
+				group := sh.retryHeap[0].group
+				ig, ok := sh.groups[group]
+				sh.mu.Unlock()
+				if !ok {
+					continue
 				}
-				ig.mu.Unlock()
-				return true
-			})
+				e.retryGroup(sh, group, ig, now)
+			}
 		case <-e.stop:
 			return
 		}
 	}
 }
+
+// deadLetterEntry 記錄一筆在 retryGroup 裡被淘汰的項目，等放開 ig.mu 之後
+// 才拿去呼叫 OnDeadLetter，見 retryGroup 內的說明。
+type deadLetterEntry struct {
+	key      string
+	item     SyncItem
+	attempts int
+}
+
+// retryGroup 處理單一 group 的重試跟 dead-letter 淘汰，並依最新狀態更新這個
+// group 在 shard retryHeap 裡的位置。
+func (e *SyncEngine) retryGroup(sh *shard, group string, ig *itemGroup, now int64) {
+	ig.mu.Lock()
+
+	// 逐筆比對 nextRetryAt，而非整個 group 共用一個 lastSent 門檻，
+	// 避免單一卡住的項目拖延其他可以重送的項目。
+	retryable := make([]SyncItem, 0)
+	var deadLettered []deadLetterEntry
+	for key, node := range ig.index {
+		it := node.item
+		if ig.attempts[key] >= e.cfg.MaxRetry {
+			// 耗盡重試次數：移出 heap/attempts，轉進 dead-letter，稍後放開
+			// ig.mu 再通知使用者一次。
+			attempts := ig.attempts[key]
+			ig.remove(key)
+			delete(ig.attempts, key)
+			delete(ig.nextRetryAt, key)
+			ig.deadLetters[key] = it
+			e.metrics.IncDeadLettered(group, 1)
+			deadLettered = append(deadLettered, deadLetterEntry{key: key, item: it, attempts: attempts})
+			continue
+		}
+		if ig.attempts[key] == 0 {
+			continue
+		}
+		if now < ig.nextRetryAt[key] {
+			continue
+		}
+		retryable = append(retryable, it)
+	}
+
+	rateLimited := len(retryable) > 0 && ig.bucket != nil && !ig.bucket.Allow()
+	if rateLimited && e.cfg.Logger != nil {
+		e.cfg.Logger("[DEBUG] group %s out of rate-limit tokens, skip retry this tick", group)
+	}
+
+	var attempts []int
+	if len(retryable) > 0 && !rateLimited {
+		sentAt := now
+		attempts = make([]int, len(retryable))
+		for i, it := range retryable {
+			ig.attempts[it.Key()]++
+			ig.nextRetryAt[it.Key()] = sentAt + e.backoff(ig.attempts[it.Key()]).Nanoseconds()
+			attempts[i] = ig.attempts[it.Key()]
+		}
+		ig.lastSent = sentAt
+		e.metrics.IncRetries(group, len(retryable))
+	}
+
+	// touchRetry/heap.Fix 必須在 ig.mu 還鎖著的時候呼叫，理由同 Ack。
+	sh.mu.Lock()
+	if rateLimited {
+		// 不直接用原本的 nextRetryAt 重新排進堆裡，否則 retryLoop 的內層迴圈
+		// 會在同一個 tick 裡對這個 group 忙碌重試，直到 token bucket 補滿為止。
+		if entry, ok := sh.retryIdx[group]; ok {
+			entry.at = now + e.cfg.Tick.Nanoseconds()
+			heap.Fix(&sh.retryHeap, entry.index)
+		}
+	} else {
+		sh.touchRetry(group, ig)
+	}
+	sh.mu.Unlock()
+	ig.mu.Unlock()
+
+	// 項目進了 dead-letter 就不會再被重送，等同 Ack 過：write-through 到
+	// Storage，讓 WAL 不會永遠留著這筆、也讓 replay 不會在重啟後把它撈回來
+	// 重新參與 retry。
+	if e.cfg.Storage != nil {
+		for _, dl := range deadLettered {
+			if err := e.cfg.Storage.MarkAcked(group, []string{dl.key}); err != nil && e.cfg.Logger != nil {
+				e.cfg.Logger("[WARN] storage mark acked (dead-letter) failed: %v", err)
+			}
+		}
+	}
+
+	// OnDeadLetter 在放開 ig.mu 之後才呼叫：callback 若反過來呼叫 Requeue/
+	// DeadLetters/Add 就會需要重新拿 ig.mu，在呼叫當下持有它會直接死鎖。
+	// 比照 OnDispatch 走 executor + recover，單一 callback panic 不會永久
+	// 弄掛這個 shard 的 retry goroutine。
+	if e.cfg.OnDeadLetter != nil {
+		for _, dl := range deadLettered {
+			e.submitDeadLetter(group, dl.item, dl.attempts)
+		}
+	}
+
+	if len(retryable) > 0 && !rateLimited {
+		e.submitDispatch(group, retryable, attempts, "start retrying...")
+	}
+}
+
+// submitDeadLetter 把一次 OnDeadLetter 呼叫丟進 executor 執行，並用跟
+// submitDispatch 一樣的 recover 包起來，同時算進 e.inflight 讓 Stop 會等它
+// 跑完。
+func (e *SyncEngine) submitDeadLetter(group string, item SyncItem, attempts int) {
+	executor := e.cfg.Executor
+	if executor == nil {
+		executor = &DefaultExecutor{}
+	}
+
+	e.inflight.Add(1)
+	executor.Submit(func() {
+		defer e.inflight.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				if e.cfg.Logger != nil {
+					e.cfg.Logger("[WARN] OnDeadLetter panic: %v", r)
+				}
+			}
+		}()
+		e.cfg.OnDeadLetter(group, item, attempts)
+	})
+}
@@ -1,6 +1,7 @@
 package syncengine
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
@@ -26,7 +27,7 @@ func ExampleSyncEngine() {
 		FlushAfter: 1 * time.Second,
 		RetryAfter: 10 * time.Second,
 		Tick:       2 * time.Second,
-		OnDispatch: func(group string, batch []SyncItem) {
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
 			for _, it := range batch {
 				if mi, ok := it.(*MyItem); ok {
 					log.Printf("  -> send %s, content: %s\n", it.Key(), mi.content)
@@ -51,7 +52,7 @@ func ExampleSyncEngine() {
 		},
 	})
 	engine.Start()
-	defer engine.Stop()
+	defer engine.Stop(context.Background())
 
 	// 模擬加入
 	for i := 0; i <= 10; i++ {
@@ -68,7 +69,4 @@ func ExampleSyncEngine() {
 		engine.Ack("JP101", []string{"ORD_000"})
 		log.Println("  -> ack ORD_000")
 	})
-
-	select {}
-	// output:
 }
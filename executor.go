@@ -0,0 +1,9 @@
+package syncengine
+
+// DefaultExecutor 用原生 goroutine 執行每個 task，沒有上限也不做 pool 管理，
+// 適合大多數情境；需要限制併發度或觀察 goroutine 數量時可自行實作 AsyncExecutor。
+type DefaultExecutor struct{}
+
+func (d *DefaultExecutor) Submit(task func()) {
+	go task()
+}
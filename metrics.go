@@ -0,0 +1,35 @@
+package syncengine
+
+import "time"
+
+// Metrics 是可插拔的觀測介面。預設是 nopMetrics（全部不做事），實際專案可以用
+// prom 子套件把這些指標接到 prometheus.Registerer，或自行實作接別的系統。
+type Metrics interface {
+	IncItemsAdded(group string)
+	IncBatchesDispatched(group string)
+	IncItemsAcked(group string, n int)
+	IncRetries(group string, n int)
+	IncDeadLettered(group string, n int)
+	IncDispatchPanics(group string)
+
+	SetPendingItems(group string, n int)
+	SetGroups(n int)
+
+	ObserveDispatchLatency(group string, d time.Duration)
+	ObserveItemAgeAtDispatch(group string, age time.Duration)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncItemsAdded(group string)                               {}
+func (nopMetrics) IncBatchesDispatched(group string)                        {}
+func (nopMetrics) IncItemsAcked(group string, n int)                        {}
+func (nopMetrics) IncRetries(group string, n int)                           {}
+func (nopMetrics) IncDeadLettered(group string, n int)                      {}
+func (nopMetrics) IncDispatchPanics(group string)                           {}
+func (nopMetrics) SetPendingItems(group string, n int)                      {}
+func (nopMetrics) SetGroups(n int)                                          {}
+func (nopMetrics) ObserveDispatchLatency(group string, d time.Duration)     {}
+func (nopMetrics) ObserveItemAgeAtDispatch(group string, age time.Duration) {}
+
+var _ Metrics = nopMetrics{}
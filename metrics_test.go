@@ -0,0 +1,134 @@
+package syncengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMetrics 記錄每個 Metrics 方法被呼叫的次數，供測試斷言用。
+type recordingMetrics struct {
+	mu                sync.Mutex
+	itemsAdded        int
+	batchesDispatched int
+	itemsAcked        int
+	pendingItems      int
+}
+
+func (m *recordingMetrics) IncItemsAdded(group string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.itemsAdded++
+}
+func (m *recordingMetrics) IncBatchesDispatched(group string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batchesDispatched++
+}
+func (m *recordingMetrics) IncItemsAcked(group string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.itemsAcked += n
+}
+func (m *recordingMetrics) IncRetries(group string, n int)      {}
+func (m *recordingMetrics) IncDeadLettered(group string, n int) {}
+func (m *recordingMetrics) IncDispatchPanics(group string)      {}
+func (m *recordingMetrics) SetPendingItems(group string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pendingItems = n
+}
+func (m *recordingMetrics) SetGroups(n int)                                          {}
+func (m *recordingMetrics) ObserveDispatchLatency(group string, d time.Duration)     {}
+func (m *recordingMetrics) ObserveItemAgeAtDispatch(group string, age time.Duration) {}
+
+func (m *recordingMetrics) snapshot() (itemsAdded, batchesDispatched, itemsAcked, pendingItems int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.itemsAdded, m.batchesDispatched, m.itemsAcked, m.pendingItems
+}
+
+func TestMetricsWiredThroughAddDispatchAck(t *testing.T) {
+	metrics := &recordingMetrics{}
+	var ackOnce sync.Once
+
+	var engine *SyncEngine
+	engine = NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   3,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			ackOnce.Do(func() {
+				keys := make([]string, len(batch))
+				for i, it := range batch {
+					keys[i] = it.Key()
+				}
+				engine.Ack(group, keys)
+			})
+		},
+		Metrics: metrics,
+		Shards:  1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	waitFor(t, 2*time.Second, func() bool {
+		_, _, acked, _ := metrics.snapshot()
+		return acked == 1
+	})
+
+	itemsAdded, batchesDispatched, itemsAcked, pendingItems := metrics.snapshot()
+	if itemsAdded != 1 {
+		t.Errorf("itemsAdded = %d, want 1", itemsAdded)
+	}
+	if batchesDispatched < 1 {
+		t.Errorf("batchesDispatched = %d, want >= 1", batchesDispatched)
+	}
+	if itemsAcked != 1 {
+		t.Errorf("itemsAcked = %d, want 1", itemsAcked)
+	}
+	if pendingItems != 0 {
+		t.Errorf("pendingItems after ack = %d, want 0", pendingItems)
+	}
+}
+
+// TestDispatchWithoutLoggerDoesNotPanic 重現先前的回歸：Logger 未設定時，
+// submitDispatch 不該直接呼叫 nil Logger（正常訊息或 panic-recovery 訊息都一樣）。
+func TestDispatchWithoutLoggerDoesNotPanic(t *testing.T) {
+	dispatched := make(chan struct{}, 1)
+
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   1,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			select {
+			case dispatched <- struct{}{}:
+			default:
+			}
+		},
+		// Logger 故意留空。
+		Shards: 1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	select {
+	case <-dispatched:
+	case <-time.After(2 * time.Second):
+		t.Fatal("dispatch never happened (or the engine crashed) with no Logger configured")
+	}
+}
@@ -0,0 +1,159 @@
+package syncengine
+
+import "container/heap"
+
+// PrioritySyncItem 是選用介面：實作它的 SyncItem 可以影響批次排序，數字越大
+// 越緊急。沒有實作這個介面的項目一律視為 priority 0。
+type PrioritySyncItem interface {
+	SyncItem
+	Priority() int
+}
+
+func itemPriority(item SyncItem) int {
+	if p, ok := item.(PrioritySyncItem); ok {
+		return p.Priority()
+	}
+	return 0
+}
+
+// heapNode 是 groupHeap 裡的一個節點，key 額外存一份方便在 attempts/nextRetryAt
+// 之類的 side map 裡查找，不用每次都呼叫 item.Key()。一個節點在還沒送出
+// （attempts == 0）的時候同時活在 unsentHeap 裡，讓 popUnsentBatch/hasUrgent
+// 不必每次都掃過整個 group，只看 unsentHeap 自己的堆頂即可。
+type heapNode struct {
+	item        SyncItem
+	key         string
+	priority    int
+	index       int  // 由 groupHeap 維護，代表目前在 heap 裡的位置
+	unsentIndex int  // 由 unsentHeap 維護，代表目前在 unsentHeap 裡的位置
+	inUnsent    bool // 是否目前在 unsentHeap 裡（即尚未送出）
+}
+
+// groupHeap 依 (priority desc, Timestamp asc) 排序，裝著 group 裡所有尚未 ack
+// 的項目（包含已送出、在等重試的）；下一批要送出的項目由 unsentHeap 挑選。
+type groupHeap []*heapNode
+
+func (h groupHeap) Len() int { return len(h) }
+
+func (h groupHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].item.Timestamp() < h[j].item.Timestamp()
+}
+
+func (h groupHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *groupHeap) Push(x any) {
+	n := x.(*heapNode)
+	n.index = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *groupHeap) Pop() any {
+	old := *h
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return node
+}
+
+// unsentHeap 跟 groupHeap 排序規則相同，但只裝尚未送出（attempts == 0）的
+// 節點，維護自己的 unsentIndex，讓 popUnsentBatch/hasUrgent 不必走過那些
+// 已經送出、正在等重試的節點。
+type unsentHeap []*heapNode
+
+func (h unsentHeap) Len() int { return len(h) }
+
+func (h unsentHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].item.Timestamp() < h[j].item.Timestamp()
+}
+
+func (h unsentHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].unsentIndex = i
+	h[j].unsentIndex = j
+}
+
+func (h *unsentHeap) Push(x any) {
+	n := x.(*heapNode)
+	n.unsentIndex = len(*h)
+	*h = append(*h, n)
+}
+
+func (h *unsentHeap) Pop() any {
+	old := *h
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return node
+}
+
+// upsert 新增或更新 key 對應的項目，回傳該節點。新節點一定是尚未送出的，
+// 所以同時會被放進 unsentHeap。
+func (ig *itemGroup) upsert(item SyncItem) *heapNode {
+	if node, ok := ig.index[item.Key()]; ok {
+		node.item = item
+		node.priority = itemPriority(item)
+		heap.Fix(&ig.heap, node.index)
+		if node.inUnsent {
+			heap.Fix(&ig.unsentHeap, node.unsentIndex)
+		}
+		return node
+	}
+	node := &heapNode{item: item, key: item.Key(), priority: itemPriority(item)}
+	heap.Push(&ig.heap, node)
+	ig.index[node.key] = node
+	node.inUnsent = true
+	heap.Push(&ig.unsentHeap, node)
+	return node
+}
+
+// remove 把 key 從 heap、unsentHeap 跟 index 移除，呼叫端須自行清掉
+// attempts/nextRetryAt。
+func (ig *itemGroup) remove(key string) {
+	node, ok := ig.index[key]
+	if !ok {
+		return
+	}
+	heap.Remove(&ig.heap, node.index)
+	if node.inUnsent {
+		heap.Remove(&ig.unsentHeap, node.unsentIndex)
+		node.inUnsent = false
+	}
+	delete(ig.index, key)
+}
+
+// popUnsentBatch 從 unsentHeap 堆頂開始取出最多 batchSize 筆尚未送出的項目，
+// 優先送出 priority 高、Timestamp 早的項目。呼叫端隨後一定會把這些項目的
+// attempts 從 0 記成非 0（開始派發），所以這裡直接把節點移出 unsentHeap，
+// 不會放回去；項目本身留在 ig.heap/ig.index 裡，只有 Ack 或進 dead-letter
+// 才會整個移除。
+func (ig *itemGroup) popUnsentBatch(batchSize int) []SyncItem {
+	var batch []SyncItem
+	for ig.unsentHeap.Len() > 0 && len(batch) < batchSize {
+		node := heap.Pop(&ig.unsentHeap).(*heapNode)
+		node.inUnsent = false
+		batch = append(batch, node.item)
+	}
+	return batch
+}
+
+// hasUrgent 回傳這個 group 裡是否存在任何尚未送出且 priority >= threshold
+// 的項目。unsentHeap 只裝尚未送出的節點且排序規則跟 groupHeap 一樣，所以
+// 只要看它自己的堆頂就知道未送出項目裡最高的 priority 是多少。
+func (ig *itemGroup) hasUrgent(threshold int) bool {
+	if len(ig.unsentHeap) == 0 {
+		return false
+	}
+	return ig.unsentHeap[0].priority >= threshold
+}
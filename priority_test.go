@@ -0,0 +1,78 @@
+package syncengine
+
+import "testing"
+
+type priorityItem struct {
+	key      string
+	group    string
+	ts       int64
+	priority int
+}
+
+func (p *priorityItem) Key() string      { return p.key }
+func (p *priorityItem) Group() string    { return p.group }
+func (p *priorityItem) Timestamp() int64 { return p.ts }
+func (p *priorityItem) Priority() int    { return p.priority }
+
+func newTestItemGroup() *itemGroup {
+	return &itemGroup{
+		index:       make(map[string]*heapNode),
+		attempts:    make(map[string]int),
+		nextRetryAt: make(map[string]int64),
+		deadLetters: make(map[string]SyncItem),
+	}
+}
+
+// TestHasUrgentChecksUnsentItemsBehindAnInFlightOne 重現一個回歸：堆頂是優先度
+// 更高但已經在重試中（attempts > 0）的項目時，hasUrgent 仍必須找到排在它
+// 後面、優先度較低但尚未送出且達門檻的項目。
+func TestHasUrgentChecksUnsentItemsBehindAnInFlightOne(t *testing.T) {
+	ig := newTestItemGroup()
+
+	a := &priorityItem{key: "A", group: "g1", ts: 1, priority: 10}
+	ig.upsert(a)
+	if popped := ig.popUnsentBatch(1); len(popped) != 1 || popped[0].Key() != "A" {
+		t.Fatalf("setup: expected to pop A, got %v", popped)
+	}
+	ig.attempts["A"] = 1 // 已經送出、在等重試：離開 unsentHeap
+
+	b := &priorityItem{key: "B", group: "g1", ts: 2, priority: 8}
+	ig.upsert(b)
+	// B 尚未送出：attempts["B"] 預設為 0，還在 unsentHeap 裡
+
+	if !ig.hasUrgent(5) {
+		t.Fatal("expected hasUrgent(5) to be true: unsent item B (priority 8) meets the threshold")
+	}
+	if ig.hasUrgent(9) {
+		t.Fatal("expected hasUrgent(9) to be false: only unsent item is B at priority 8")
+	}
+}
+
+func TestHasUrgentFalseWhenNothingUnsentMeetsThreshold(t *testing.T) {
+	ig := newTestItemGroup()
+	ig.upsert(&priorityItem{key: "A", group: "g1", ts: 1, priority: 3})
+
+	if ig.hasUrgent(5) {
+		t.Fatal("expected hasUrgent(5) to be false: only unsent item is below threshold")
+	}
+}
+
+func TestPopUnsentBatchOrdersByPriorityThenTimestamp(t *testing.T) {
+	ig := newTestItemGroup()
+	ig.upsert(&priorityItem{key: "low-early", group: "g1", ts: 1, priority: 1})
+	ig.upsert(&priorityItem{key: "high-late", group: "g1", ts: 2, priority: 9})
+	ig.upsert(&priorityItem{key: "high-early", group: "g1", ts: 0, priority: 9})
+
+	batch := ig.popUnsentBatch(2)
+	if len(batch) != 2 {
+		t.Fatalf("expected batch of 2, got %d", len(batch))
+	}
+	if batch[0].Key() != "high-early" || batch[1].Key() != "high-late" {
+		t.Fatalf("expected [high-early, high-late] first, got [%s, %s]", batch[0].Key(), batch[1].Key())
+	}
+
+	// popUnsentBatch 不該把項目移出 heap，只是挑出一批。
+	if ig.heap.Len() != 3 {
+		t.Fatalf("expected all 3 items to remain in heap, got %d", ig.heap.Len())
+	}
+}
@@ -0,0 +1,50 @@
+package syncengine
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit 設定單一 group 的 token bucket：Rate 是每秒補充的 token 數，
+// Burst 是 bucket 容量上限。Rate <= 0 代表不限速。
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// tokenBucket 是每個 group 各自持有的簡單 token bucket，懶惰補充 token，
+// 不需要額外的 ticker goroutine。
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   int64 // UnixNano
+}
+
+func newTokenBucket(rl RateLimit) *tokenBucket {
+	return &tokenBucket{
+		rate:   rl.Rate,
+		burst:  float64(rl.Burst),
+		tokens: float64(rl.Burst),
+		last:   time.Now().UnixNano(),
+	}
+}
+
+// Allow 嘗試消耗一個 token（代表一次要送出的 batch），成功回傳 true。
+func (tb *tokenBucket) Allow() bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	elapsed := float64(now-tb.last) / float64(time.Second)
+	if elapsed > 0 {
+		tb.tokens = min(tb.burst, tb.tokens+elapsed*tb.rate)
+		tb.last = now
+	}
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
@@ -0,0 +1,37 @@
+package syncengine
+
+import "testing"
+
+func TestTokenBucketAllowBurstThenBlocks(t *testing.T) {
+	tb := newTokenBucket(RateLimit{Rate: 1, Burst: 2})
+
+	if !tb.Allow() {
+		t.Fatal("expected first Allow to succeed within burst")
+	}
+	if !tb.Allow() {
+		t.Fatal("expected second Allow to succeed within burst")
+	}
+	if tb.Allow() {
+		t.Fatal("expected third Allow to fail once burst is exhausted")
+	}
+}
+
+func TestTokenBucketRefillsOverTime(t *testing.T) {
+	tb := newTokenBucket(RateLimit{Rate: 1000, Burst: 1})
+	if !tb.Allow() {
+		t.Fatal("expected first Allow to succeed")
+	}
+	if tb.Allow() {
+		t.Fatal("expected bucket to be empty immediately after")
+	}
+
+	// 模擬時間流逝：直接把 last 往回撥，等同經過 10ms，用 rate=1000/s 應該
+	// 補回至少 1 個 token。
+	tb.mu.Lock()
+	tb.last -= int64(10 * 1e6) // 10ms in nanoseconds
+	tb.mu.Unlock()
+
+	if !tb.Allow() {
+		t.Fatal("expected Allow to succeed after tokens refill")
+	}
+}
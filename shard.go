@@ -0,0 +1,95 @@
+package syncengine
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// shard 持有一部分 group，讓 dispatchLoop/retryLoop 不用每個 tick 都掃過全部
+// group。dirty 記錄收到過 Add/Requeue、可能還有尚未送出項目的 group，直到它
+// 的未送出項目都送出為止，讓 dispatch 掃描量跟著活躍流量走，而不是跟著 group
+// 總數走。retryHeap 則是依
+// group 最早可重試時間排序，讓 retry 掃描只需要看堆頂，O(log N) 攤提。
+type shard struct {
+	mu     sync.Mutex
+	groups map[string]*itemGroup
+
+	dirty map[string]struct{}
+
+	retryHeap retryHeap
+	retryIdx  map[string]*retryEntry // group -> 對應的堆節點
+}
+
+func newShard() *shard {
+	return &shard{
+		groups:   make(map[string]*itemGroup),
+		dirty:    make(map[string]struct{}),
+		retryIdx: make(map[string]*retryEntry),
+	}
+}
+
+// retryEntry 代表一個 group 最早可能需要重試（或送進 dead-letter）的時間。
+type retryEntry struct {
+	group string
+	at    int64 // UnixNano，math.MaxInt64 代表目前沒有等待中的重試
+	index int
+}
+
+type retryHeap []*retryEntry
+
+func (h retryHeap) Len() int            { return len(h) }
+func (h retryHeap) Less(i, j int) bool  { return h[i].at < h[j].at }
+func (h retryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *retryHeap) Push(x any) {
+	e := x.(*retryEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *retryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+// noPendingRetry 代表這個 group 目前沒有等待中的重試，排到堆尾不影響掃描。
+const noPendingRetry = int64(math.MaxInt64)
+
+// touchRetry 依 ig 目前的狀態重新計算最早可重試時間，並更新（或新建）shard
+// 裡對應的堆節點。呼叫端必須持有 sh.mu 跟 ig.mu。
+func (sh *shard) touchRetry(group string, ig *itemGroup) {
+	at := ig.earliestRetryAt()
+	entry, ok := sh.retryIdx[group]
+	if !ok {
+		entry = &retryEntry{group: group, at: at}
+		heap.Push(&sh.retryHeap, entry)
+		sh.retryIdx[group] = entry
+		return
+	}
+	entry.at = at
+	heap.Fix(&sh.retryHeap, entry.index)
+}
+
+func (sh *shard) markDirty(group string) {
+	sh.dirty[group] = struct{}{}
+}
+
+func (sh *shard) clearDirty(group string) {
+	delete(sh.dirty, group)
+}
+
+func shardIndex(group string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(group))
+	return int(h.Sum32()) % n
+}
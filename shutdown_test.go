@@ -0,0 +1,207 @@
+package syncengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStopFlushesPendingItemsAndWaitsForInFlight 確認 Stop 會無視 BatchSize/
+// FlushAfter 門檻把尚未送出的項目 flush 出去，並等到 dispatch 真的跑完才返回。
+func TestStopFlushesPendingItemsAndWaitsForInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var dispatched []string
+
+	engine := NewEngine(Config{
+		BatchSize:  100, // 故意設很大，靠 Stop 強制 flush，而不是湊滿一批
+		MaxRetry:   3,
+		FlushAfter: time.Hour,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			time.Sleep(20 * time.Millisecond) // 確保 Stop 真的需要等 inflight
+			mu.Lock()
+			for _, it := range batch {
+				dispatched = append(dispatched, it.Key())
+			}
+			mu.Unlock()
+		},
+		Shards: 1,
+	})
+	engine.Start()
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dispatched) != 1 || dispatched[0] != "a" {
+		t.Fatalf("expected %q to be flushed by Stop, got %v", "a", dispatched)
+	}
+}
+
+// TestStopWaitsForLoopTriggeredDispatch 確認 Stop 會先等 dispatchLoop/
+// retryLoop 真的退出，才去 flush 跟等 inflight：用 BatchSize 1
+// 讓 tick 自己就能觸發 dispatch，而不是靠 flushAll，藉此重現「Stop 在 tick
+// 已經送出一批之後才返回，而不是提早跟一個瞬間歸零的 WaitGroup 計數器賽跑」
+// 的情境。
+func TestStopWaitsForLoopTriggeredDispatch(t *testing.T) {
+	var mu sync.Mutex
+	var dispatched []string
+
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   3,
+		FlushAfter: time.Hour,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			for _, it := range batch {
+				dispatched = append(dispatched, it.Key())
+			}
+			mu.Unlock()
+		},
+		Shards: 1,
+	})
+	engine.Start()
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	// 讓 tick 自己先觸發 dispatchGroup，而不是靠 Stop 的 flushAll。
+	time.Sleep(8 * time.Millisecond)
+
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dispatched) != 1 || dispatched[0] != "a" {
+		t.Fatalf("expected %q to be dispatched and waited on by Stop, got %v", "a", dispatched)
+	}
+}
+
+// TestAddAfterStopReturnsErrEngineStopped 確認 Stop 之後再呼叫 Add 會一律
+// 回傳 ErrEngineStopped，且可以安全地重複呼叫 Stop。
+func TestAddAfterStopReturnsErrEngineStopped(t *testing.T) {
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   1,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {},
+		Shards:     1,
+	})
+	engine.Start()
+
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := engine.Stop(context.Background()); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+
+	err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()})
+	if err != ErrEngineStopped {
+		t.Fatalf("Add after Stop = %v, want ErrEngineStopped", err)
+	}
+}
+
+// TestStopRespectsContextDeadline 確認當 dispatch 卡住跑不完時，Stop 不會
+// 死等，而是在 ctx 到期時回傳 ctx.Err()。
+func TestStopRespectsContextDeadline(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   1,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			<-block
+		},
+		Shards: 1,
+	})
+	engine.Start()
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond) // 讓 dispatch 先真的開始跑（進入 <-block）
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	if err := engine.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Stop with stuck dispatch = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// TestDrainWaitsUntilGroupsEmpty 確認 Drain 會強制 flush 並等到所有 group
+// 清空（items 被 Ack 掉）為止，回傳 true。
+func TestDrainWaitsUntilGroupsEmpty(t *testing.T) {
+	var engine *SyncEngine
+	engine = NewEngine(Config{
+		BatchSize:  100,
+		MaxRetry:   3,
+		FlushAfter: time.Hour,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			keys := make([]string, len(batch))
+			for i, it := range batch {
+				keys[i] = it.Key()
+			}
+			engine.Ack(group, keys)
+		},
+		Shards: 1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	if !engine.Drain(2 * time.Second) {
+		t.Fatal("expected Drain to report all groups empty")
+	}
+}
+
+// TestDrainTimesOutWhenGroupNeverEmpties 確認逾時時 Drain 回傳 false，而不是
+// 死等下去。
+func TestDrainTimesOutWhenGroupNeverEmpties(t *testing.T) {
+	engine := NewEngine(Config{
+		BatchSize:  1,
+		MaxRetry:   100,
+		FlushAfter: 5 * time.Millisecond,
+		RetryAfter: time.Hour,
+		Tick:       5 * time.Millisecond,
+		OnDispatch: func(ctx context.Context, group string, batch []SyncItem) {
+			// 故意不 ack，group 永遠不會清空。
+		},
+		Shards: 1,
+	})
+	engine.Start()
+	defer engine.Stop(context.Background())
+
+	if err := engine.Add(&dlItem{key: "a", group: "g1", ts: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	if engine.Drain(30 * time.Millisecond) {
+		t.Fatal("expected Drain to time out and report false")
+	}
+}
@@ -0,0 +1,364 @@
+package syncengine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Storage 是可插拔的持久化介面：Add/Ack 會透過它 write-through，
+// NewEngine 啟動時則用 LoadPending 回放尚未 ack 的項目，避免崩潰後資料遺失。
+// 預設實作是 FileStorage；要接 BoltDB、SQLite 等，只要實作同一介面即可。
+type Storage interface {
+	Append(item SyncItem) error
+	MarkAcked(group string, keys []string) error
+	LoadPending() ([]SyncItem, error)
+}
+
+// Codec 負責把 SyncItem 序列化成 bytes、以及反序列化回來。
+// 因為 SyncItem 是介面，Decode 需要知道要建構哪個具體型別，
+// 所以 JSONCodec/GobCodec 都要求使用者提供 New，回傳該型別的零值指標。
+type Codec interface {
+	Encode(item SyncItem) ([]byte, error)
+	Decode(data []byte) (SyncItem, error)
+}
+
+// JSONCodec 用 encoding/json 編解碼 SyncItem。New 必須回傳一個指向
+// 具體型別的指標（例如 func() SyncItem { return &MyItem{} }），Decode
+// 會用它來 Unmarshal。
+type JSONCodec struct {
+	New func() SyncItem
+}
+
+func (c JSONCodec) Encode(item SyncItem) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (c JSONCodec) Decode(data []byte) (SyncItem, error) {
+	item := c.New()
+	if err := json.Unmarshal(data, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// GobCodec 用 encoding/gob 編解碼 SyncItem，適合欄位較多或型別本身
+// 已經用 gob 的場合。跟 JSONCodec 一樣需要 New 來建構具體型別。
+type GobCodec struct {
+	New func() SyncItem
+}
+
+func (c GobCodec) Encode(item SyncItem) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(item); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c GobCodec) Decode(data []byte) (SyncItem, error) {
+	item := c.New()
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// record 類型：append 寫入一筆 item，ack 代表該 group 下的某些 key 已確認。
+const (
+	recordAppend byte = 1
+	recordAck    byte = 2
+)
+
+// FileStorage 是預設的 file-backed WAL：Append/MarkAcked 先寫進記憶體緩衝，
+// 背景 goroutine 依 FlushInterval 批次 fsync，兼顧耐久性跟寫入效能。
+// 每累積 CompactEvery 次 ack 後，會重寫檔案只保留尚未 ack 的項目，避免無限成長。
+type FileStorage struct {
+	path         string
+	codec        Codec
+	compactEvery int
+
+	mu       sync.Mutex
+	f        *os.File
+	w        *bufio.Writer
+	ackCount int
+
+	flushInterval time.Duration
+	stop          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewFileStorage 開啟（或建立）path 作為 WAL 檔案。flushInterval <= 0 時
+// 每次 Append/MarkAcked 都會立即 fsync；compactEvery <= 0 則關閉自動 compaction。
+func NewFileStorage(path string, codec Codec, flushInterval time.Duration, compactEvery int) (*FileStorage, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("syncengine: open wal: %w", err)
+	}
+	fs := &FileStorage{
+		path:          path,
+		codec:         codec,
+		compactEvery:  compactEvery,
+		f:             f,
+		w:             bufio.NewWriter(f),
+		flushInterval: flushInterval,
+		stop:          make(chan struct{}),
+	}
+	if flushInterval > 0 {
+		fs.wg.Add(1)
+		go fs.flushLoop()
+	}
+	return fs, nil
+}
+
+func (fs *FileStorage) flushLoop() {
+	defer fs.wg.Done()
+	ticker := time.NewTicker(fs.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fs.mu.Lock()
+			fs.flushLocked()
+			fs.mu.Unlock()
+		case <-fs.stop:
+			return
+		}
+	}
+}
+
+func (fs *FileStorage) flushLocked() error {
+	if err := fs.w.Flush(); err != nil {
+		return err
+	}
+	return fs.f.Sync()
+}
+
+func (fs *FileStorage) writeRecord(typ byte, payload []byte) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var hdr [5]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	if _, err := fs.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := fs.w.Write(payload); err != nil {
+		return err
+	}
+	if fs.flushInterval <= 0 {
+		fs.flushLocked()
+	}
+	return nil
+}
+
+func (fs *FileStorage) Append(item SyncItem) error {
+	data, err := fs.codec.Encode(item)
+	if err != nil {
+		return fmt.Errorf("syncengine: encode item: %w", err)
+	}
+	payload := append([]byte(item.Group()+"\x00"), data...)
+	return fs.writeRecord(recordAppend, payload)
+}
+
+func (fs *FileStorage) MarkAcked(group string, keys []string) error {
+	payload := []byte(group)
+	for _, k := range keys {
+		payload = append(payload, '\x00')
+		payload = append(payload, []byte(k)...)
+	}
+	if err := fs.writeRecord(recordAck, payload); err != nil {
+		return err
+	}
+
+	fs.mu.Lock()
+	fs.ackCount++
+	needCompact := fs.compactEvery > 0 && fs.ackCount >= fs.compactEvery
+	if needCompact {
+		fs.ackCount = 0
+	}
+	fs.mu.Unlock()
+
+	if needCompact {
+		return fs.Compact()
+	}
+	return nil
+}
+
+// LoadPending 從頭重播 WAL，套用所有 append/ack，回傳尚未 ack 的項目。
+func (fs *FileStorage) LoadPending() ([]SyncItem, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.flushLocked(); err != nil {
+		return nil, err
+	}
+	if _, err := fs.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	defer fs.f.Seek(0, io.SeekEnd)
+
+	pending := make(map[string]map[string]SyncItem)
+	r := bufio.NewReader(fs.f)
+	for {
+		item, group, acked, keys, err := readRecord(r, fs.codec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("syncengine: replay wal: %w", err)
+		}
+		if acked {
+			g := pending[group]
+			for _, k := range keys {
+				delete(g, k)
+			}
+			continue
+		}
+		g, ok := pending[group]
+		if !ok {
+			g = make(map[string]SyncItem)
+			pending[group] = g
+		}
+		g[item.Key()] = item
+	}
+
+	var out []SyncItem
+	for _, g := range pending {
+		for _, it := range g {
+			out = append(out, it)
+		}
+	}
+	return out, nil
+}
+
+func readRecord(r *bufio.Reader, codec Codec) (item SyncItem, group string, acked bool, keys []string, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	typ := hdr[0]
+	n := binary.BigEndian.Uint32(hdr[1:])
+	payload := make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+
+	switch typ {
+	case recordAppend:
+		parts := splitOnce(payload, '\x00')
+		group = string(parts[0])
+		item, err = codec.Decode(parts[1])
+	case recordAck:
+		fields := splitAll(payload, '\x00')
+		group = string(fields[0])
+		keys = make([]string, len(fields)-1)
+		for i, f := range fields[1:] {
+			keys[i] = string(f)
+		}
+		acked = true
+	default:
+		err = fmt.Errorf("syncengine: unknown wal record type %d", typ)
+	}
+	return
+}
+
+// Compact 重寫 WAL，只保留目前尚未 ack 的項目，把歷史 ack 記錄清掉以限制檔案成長。
+func (fs *FileStorage) Compact() error {
+	pending, err := fs.LoadPending()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fs.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("syncengine: create compact file: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for _, item := range pending {
+		data, err := fs.codec.Encode(item)
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("syncengine: encode item: %w", err)
+		}
+		payload := append([]byte(item.Group()+"\x00"), data...)
+		var hdr [5]byte
+		hdr[0] = recordAppend
+		binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+		if _, err := w.Write(hdr[:]); err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := w.Write(payload); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.f.Close()
+	if err := os.Rename(tmpPath, fs.path); err != nil {
+		return fmt.Errorf("syncengine: install compacted wal: %w", err)
+	}
+	f, err := os.OpenFile(fs.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("syncengine: reopen wal: %w", err)
+	}
+	fs.f = f
+	fs.w = bufio.NewWriter(f)
+	return nil
+}
+
+// Close flush 緩衝並停止背景 flush goroutine。
+func (fs *FileStorage) Close() error {
+	if fs.flushInterval > 0 {
+		close(fs.stop)
+		fs.wg.Wait()
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.flushLocked()
+	return fs.f.Close()
+}
+
+func splitOnce(b []byte, sep byte) [2][]byte {
+	for i, c := range b {
+		if c == sep {
+			return [2][]byte{b[:i], b[i+1:]}
+		}
+	}
+	return [2][]byte{b, nil}
+}
+
+func splitAll(b []byte, sep byte) [][]byte {
+	var out [][]byte
+	start := 0
+	for i, c := range b {
+		if c == sep {
+			out = append(out, b[start:i])
+			start = i + 1
+		}
+	}
+	out = append(out, b[start:])
+	return out
+}
@@ -0,0 +1,126 @@
+package syncengine
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+type storageItem struct {
+	K, G string
+	TS   int64
+}
+
+func (s *storageItem) Key() string      { return s.K }
+func (s *storageItem) Group() string    { return s.G }
+func (s *storageItem) Timestamp() int64 { return s.TS }
+
+func newTestStorage(t *testing.T) *FileStorage {
+	t.Helper()
+	codec := JSONCodec{New: func() SyncItem { return &storageItem{} }}
+	fs, err := NewFileStorage(filepath.Join(t.TempDir(), "wal"), codec, 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+func TestFileStorageAppendAndLoadPending(t *testing.T) {
+	fs := newTestStorage(t)
+
+	if err := fs.Append(&storageItem{K: "a", G: "g1", TS: 1}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := fs.Append(&storageItem{K: "b", G: "g1", TS: 2}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	pending, err := fs.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending items, got %d", len(pending))
+	}
+}
+
+func TestFileStorageMarkAckedRemovesFromPending(t *testing.T) {
+	fs := newTestStorage(t)
+
+	if err := fs.Append(&storageItem{K: "a", G: "g1", TS: 1}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := fs.Append(&storageItem{K: "b", G: "g1", TS: 2}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := fs.MarkAcked("g1", []string{"a"}); err != nil {
+		t.Fatalf("MarkAcked: %v", err)
+	}
+
+	pending, err := fs.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Key() != "b" {
+		t.Fatalf("expected only %q pending, got %v", "b", pending)
+	}
+}
+
+func TestFileStorageCompactDropsAckedHistory(t *testing.T) {
+	codec := JSONCodec{New: func() SyncItem { return &storageItem{} }}
+	path := filepath.Join(t.TempDir(), "wal")
+	fs, err := NewFileStorage(path, codec, 0, 1)
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	defer fs.Close()
+
+	if err := fs.Append(&storageItem{K: "a", G: "g1", TS: 1}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := fs.Append(&storageItem{K: "b", G: "g1", TS: 2}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	// compactEvery == 1，這次 ack 會觸發自動 compaction。
+	if err := fs.MarkAcked("g1", []string{"a"}); err != nil {
+		t.Fatalf("MarkAcked: %v", err)
+	}
+
+	pending, err := fs.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending after compact: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Key() != "b" {
+		t.Fatalf("expected only %q pending after compact, got %v", "b", pending)
+	}
+}
+
+func TestFileStorageReplayAcrossReopen(t *testing.T) {
+	codec := JSONCodec{New: func() SyncItem { return &storageItem{} }}
+	path := filepath.Join(t.TempDir(), "wal")
+
+	fs, err := NewFileStorage(path, codec, 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileStorage: %v", err)
+	}
+	if err := fs.Append(&storageItem{K: "a", G: "g1", TS: 1}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened, err := NewFileStorage(path, codec, 0, 0)
+	if err != nil {
+		t.Fatalf("reopen NewFileStorage: %v", err)
+	}
+	defer reopened.Close()
+
+	pending, err := reopened.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending after reopen: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Key() != "a" {
+		t.Fatalf("expected item %q to survive reopen, got %v", "a", pending)
+	}
+}
@@ -0,0 +1,23 @@
+package syncengine
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/crossgate10/syncengine")
+
+// startDispatchSpan 開一個涵蓋單次 OnDispatch 呼叫的 span，並標註 group、batch
+// 大小跟每筆項目目前的重試次數，讓使用者可以在自己的 OpenTelemetry 後端裡串連。
+func startDispatchSpan(group string, batch []SyncItem, attempts []int) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(context.Background(), "syncengine.dispatch")
+	span.SetAttributes(
+		attribute.String("syncengine.group", group),
+		attribute.Int("syncengine.batch_size", len(batch)),
+		attribute.IntSlice("syncengine.attempts", attempts),
+	)
+	return ctx, span
+}